@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -16,17 +15,32 @@ import (
 
 	"github.com/runopsio/hoop/common/log"
 
+	"go.opentelemetry.io/otel/trace"
 	"olympos.io/encoding/edn"
 )
 
 const (
 	defaultAddress = "http://localhost:3000"
+	// defaultAwaitTxTimeout is used when the caller's context carries no deadline.
+	defaultAwaitTxTimeout = time.Second * 5
 )
 
 type (
 	Storage struct {
 		client  http.Client
 		address string
+
+		// retryPolicy and breaker are nil until WithRetry is called, in
+		// which case do applies the breaker to every request and the
+		// retry policy to idempotent requests only.
+		retryPolicy *RetryPolicy
+		breaker     *circuitBreaker
+
+		// metrics and tracerProvider are nil unless NewWithOptions sets
+		// them. With metrics nil, do records no metrics; with
+		// tracerProvider nil, do opens its spans on otel.GetTracerProvider().
+		metrics        *metrics
+		tracerProvider trace.TracerProvider
 	}
 	// TxEdnStruct must be a struct containing edn fields.
 	// See https://github.com/go-edn/edn.
@@ -73,51 +87,58 @@ func (s *Storage) buildTrxEvictEdn(xtIDs ...string) (string, error) {
 // SubmitPutTx sends put transactions to the xtdb API
 // https://docs.xtdb.com/clients/1.22.0/http/#submit-tx
 func (s *Storage) SubmitPutTx(trxs ...TxEdnStruct) (*TxResponse, error) {
+	return s.SubmitPutTxCtx(context.Background(), trxs...)
+}
+
+// SubmitPutTxCtx is like SubmitPutTx but propagates ctx cancellation and
+// deadlines to the outbound request and the best-effort AwaitTx call.
+func (s *Storage) SubmitPutTxCtx(ctx context.Context, trxs ...TxEdnStruct) (*TxResponse, error) {
 	url := fmt.Sprintf("%s/_xtdb/submit-tx", s.address)
 	txOpsEdn, err := s.buildTrxPutEdn(trxs...)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(txOpsEdn))
+	ctx = withRequestMeta(ctx, requestMeta{op: "submit-tx", opCount: len(trxs)})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBufferString(txOpsEdn))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("content-type", "application/edn")
 	req.Header.Set("accept", "application/edn")
+	if key := idempotencyKeyFromContext(ctx); key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
 
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return nil, err
 	}
-	if resp == nil {
-		return nil, fmt.Errorf("http response is empty")
-	}
 	defer resp.Body.Close()
 
 	var txResponse TxResponse
-	if resp.StatusCode == http.StatusAccepted {
-		if err := edn.NewDecoder(resp.Body).Decode(&txResponse); err != nil {
-			log.Warnf("error decoding transaction response, err=%v", err)
-		}
-		// make a best-effort to wait the transaction to sync
-		if txResponse.TxID > 0 {
-			if err := s.AwaitTx(txResponse.TxID); err != nil {
-				log.Warnf(err.Error())
-			}
+	if err := edn.NewDecoder(resp.Body).Decode(&txResponse); err != nil {
+		log.Warnf("error decoding transaction response, err=%v", err)
+	}
+	// make a best-effort to wait the transaction to sync
+	if txResponse.TxID > 0 {
+		if err := s.AwaitTxCtx(ctx, txResponse.TxID); err != nil {
+			log.Warnf(err.Error())
 		}
-		return &txResponse, nil
-	} else {
-		data, _ := io.ReadAll(resp.Body)
-		log.Printf("unknown status code=%v, body=%v", resp.StatusCode, string(data))
 	}
-	return nil, fmt.Errorf("received unknown status code=%v", resp.StatusCode)
+	return &txResponse, nil
 }
 
 // SubmitEvictTx sends evict transactions to the xtdb API
 // https://docs.xtdb.com/clients/1.22.0/http/#submit-tx
 func (s *Storage) SubmitEvictTx(xtIDs ...string) (*TxResponse, error) {
+	return s.SubmitEvictTxCtx(context.Background(), xtIDs...)
+}
+
+// SubmitEvictTxCtx is like SubmitEvictTx but propagates ctx cancellation and
+// deadlines to the outbound request and the best-effort AwaitTx call.
+func (s *Storage) SubmitEvictTxCtx(ctx context.Context, xtIDs ...string) (*TxResponse, error) {
 	if len(xtIDs) == 0 {
 		return nil, fmt.Errorf("need at least one xt/id to evict")
 	}
@@ -127,43 +148,74 @@ func (s *Storage) SubmitEvictTx(xtIDs ...string) (*TxResponse, error) {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(txOpsEdn))
+	ctx = withRequestMeta(ctx, requestMeta{op: "evict-tx", opCount: len(xtIDs)})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBufferString(txOpsEdn))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("content-type", "application/edn")
 	req.Header.Set("accept", "application/edn")
+	if key := idempotencyKeyFromContext(ctx); key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
 
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return nil, err
 	}
-	if resp == nil {
-		return nil, fmt.Errorf("http response is empty")
-	}
 	defer resp.Body.Close()
 
 	var txResponse TxResponse
-	if resp.StatusCode == http.StatusAccepted {
-		if err := edn.NewDecoder(resp.Body).Decode(&txResponse); err != nil {
-			log.Infof("error decoding transaction response, err=%v", err)
-		}
-		// make a best-effort to wait the transaction to sync
-		if txResponse.TxID > 0 {
-			if err := s.AwaitTx(txResponse.TxID); err != nil {
-				log.Warnf(err.Error())
-			}
+	if err := edn.NewDecoder(resp.Body).Decode(&txResponse); err != nil {
+		log.Infof("error decoding transaction response, err=%v", err)
+	}
+	// make a best-effort to wait the transaction to sync
+	if txResponse.TxID > 0 {
+		if err := s.AwaitTxCtx(ctx, txResponse.TxID); err != nil {
+			log.Warnf(err.Error())
 		}
-		return &txResponse, nil
-	} else {
-		data, _ := io.ReadAll(resp.Body)
-		log.Infof("unknown status code=%v, body=%v", resp.StatusCode, string(data))
 	}
-	return nil, fmt.Errorf("received unknown status code=%v", resp.StatusCode)
+	return &txResponse, nil
+}
+
+// submitTxEdnCtx posts an already-built {:tx-ops [...]} EDN body to the
+// submit-tx endpoint, returning the decoded TxResponse on success. Unlike
+// SubmitPutTxCtx/SubmitEvictTxCtx it does not await the resulting
+// transaction, leaving that choice to the caller.
+func (s *Storage) submitTxEdnCtx(ctx context.Context, txOpsEdn string, opCount int) (*TxResponse, error) {
+	url := fmt.Sprintf("%s/_xtdb/submit-tx", s.address)
+	ctx = withRequestMeta(ctx, requestMeta{op: "submit-tx", opCount: opCount})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBufferString(txOpsEdn))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("content-type", "application/edn")
+	req.Header.Set("accept", "application/edn")
+	if key := idempotencyKeyFromContext(ctx); key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var txResponse TxResponse
+	if err := edn.NewDecoder(resp.Body).Decode(&txResponse); err != nil {
+		return nil, fmt.Errorf("error decoding transaction response, err=%v", err)
+	}
+	return &txResponse, nil
 }
 
 func (s *Storage) PersistEntities(payloads []map[string]any) (int64, error) {
+	return s.PersistEntitiesCtx(context.Background(), payloads)
+}
+
+// PersistEntitiesCtx is like PersistEntities but propagates ctx cancellation
+// and deadlines to the outbound request and the best-effort AwaitTx call.
+func (s *Storage) PersistEntitiesCtx(ctx context.Context, payloads []map[string]any) (int64, error) {
 	url := fmt.Sprintf("%s/_xtdb/submit-tx", s.address)
 
 	bytePayload, err := buildPersistPayload(payloads)
@@ -171,7 +223,8 @@ func (s *Storage) PersistEntities(payloads []map[string]any) (int64, error) {
 		return 0, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(bytePayload))
+	ctx = withRequestMeta(ctx, requestMeta{op: "submit-tx", opCount: len(payloads)})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(bytePayload))
 	if err != nil {
 		return 0, err
 	}
@@ -179,33 +232,36 @@ func (s *Storage) PersistEntities(payloads []map[string]any) (int64, error) {
 	req.Header.Set("content-type", "application/json")
 	req.Header.Set("accept", "application/json")
 
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return 0, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusAccepted {
-		var txResponse TxResponse
-		if err := json.NewDecoder(resp.Body).Decode(&txResponse); err != nil {
-			log.Warnf("error decoding transaction response, err=%v", err)
-		}
-		// make a best-effort to wait the transaction to sync
-		if txResponse.TxID > 0 {
-			if err := s.AwaitTx(txResponse.TxID); err != nil {
-				log.Warnf(err.Error())
-			}
+	var txResponse TxResponse
+	if err := json.NewDecoder(resp.Body).Decode(&txResponse); err != nil {
+		log.Warnf("error decoding transaction response, err=%v", err)
+	}
+	// make a best-effort to wait the transaction to sync
+	if txResponse.TxID > 0 {
+		if err := s.AwaitTxCtx(ctx, txResponse.TxID); err != nil {
+			log.Warnf(err.Error())
 		}
-		return txResponse.TxID, nil
 	}
-
-	return 0, errors.New("not 202")
+	return txResponse.TxID, nil
 }
 
 func (s *Storage) GetEntity(xtId string) ([]byte, error) {
+	return s.GetEntityCtx(context.Background(), xtId)
+}
+
+// GetEntityCtx is like GetEntity but propagates ctx cancellation and
+// deadlines to the outbound request.
+func (s *Storage) GetEntityCtx(ctx context.Context, xtId string) ([]byte, error) {
 	url := fmt.Sprintf("%s/_xtdb/entity", s.address)
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	ctx = withRequestMeta(ctx, requestMeta{op: "entity"})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -216,45 +272,61 @@ func (s *Storage) GetEntity(xtId string) ([]byte, error) {
 	q.Add("eid", xtId)
 	req.URL.RawQuery = q.Encode()
 
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
 		return nil, err
 	}
 	defer resp.Body.Close()
-	switch resp.StatusCode {
-	case http.StatusOK:
-		return io.ReadAll(resp.Body)
-	case http.StatusNotFound:
-		return nil, nil
-	default:
-		return nil, fmt.Errorf("unknown http response returned fetching entity, status=%v", resp.StatusCode)
-	}
+	return io.ReadAll(resp.Body)
 }
 
 // AwaitTx Waits until the node has indexed a transaction that is at or past the supplied tx-id.
 // Returns the most recent tx indexed by the node.
 func (s *Storage) AwaitTx(txID int64) error {
-	url := fmt.Sprintf("%s/_xtdb/await-tx?tx-id=%v&timeout=5000", s.address, txID)
-	resp, err := http.Get(url)
+	return s.AwaitTxCtx(context.Background(), txID)
+}
+
+// AwaitTxCtx is like AwaitTx, but it honors ctx's deadline/cancellation
+// instead of a hard-coded 5s timeout. When ctx carries a deadline, the
+// remaining time is forwarded to xtdb as the await-tx timeout so the node
+// does not keep the request open past what the caller is willing to wait.
+func (s *Storage) AwaitTxCtx(ctx context.Context, txID int64) error {
+	timeout := defaultAwaitTxTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining > 0 {
+			timeout = remaining
+		}
+	}
+	url := fmt.Sprintf("%s/_xtdb/await-tx?tx-id=%v&timeout=%v", s.address, txID, timeout.Milliseconds())
+	ctx = withRequestMeta(ctx, requestMeta{op: "await-tx", txID: txID})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return fmt.Errorf("failed awaiting transaction %v, err=%v", txID, err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		data, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed awaiting transaction %v, code=%v, response=%v",
-			txID, resp.StatusCode, string(data))
+	resp, err := s.do(req)
+	if err != nil {
+		return withTxID(err, txID)
 	}
+	defer resp.Body.Close()
 	return nil
 }
 
 func (s *Storage) GetEntityHistory(eid, sortOrder string, withDocs bool) ([]byte, error) {
+	return s.GetEntityHistoryCtx(context.Background(), eid, sortOrder, withDocs)
+}
+
+// GetEntityHistoryCtx is like GetEntityHistory but propagates ctx
+// cancellation and deadlines to the outbound request.
+func (s *Storage) GetEntityHistoryCtx(ctx context.Context, eid, sortOrder string, withDocs bool) ([]byte, error) {
 	url := fmt.Sprintf("%s/_xtdb/entity", s.address)
 	if sortOrder != "asc" && sortOrder != "desc" {
 		return nil, fmt.Errorf("wrong sort order input, accept 'asc' or 'desc'")
 	}
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	ctx = withRequestMeta(ctx, requestMeta{op: "entity-history"})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -265,122 +337,159 @@ func (s *Storage) GetEntityHistory(eid, sortOrder string, withDocs bool) ([]byte
 	q.Add("history", "true")
 	q.Add("with-docs", fmt.Sprintf("%v", withDocs))
 	req.URL.RawQuery = q.Encode()
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
 		return nil, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusOK {
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
-		return b, nil
-	}
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, nil
-	}
-	respErr, _ := ioutil.ReadAll(resp.Body)
-	return nil, fmt.Errorf("unknown status code (%v), response=%v", resp.StatusCode, string(respErr))
+	return ioutil.ReadAll(resp.Body)
 }
 
 func (s *Storage) QueryRaw(ednQuery []byte) ([]byte, error) {
-	return s.queryRequest(ednQuery, "application/edn")
+	return s.queryRequest(context.Background(), ednQuery, "application/edn")
+}
+
+// QueryRawCtx is like QueryRaw but propagates ctx cancellation and
+// deadlines to the outbound request.
+func (s *Storage) QueryRawCtx(ctx context.Context, ednQuery []byte) ([]byte, error) {
+	return s.queryRequest(ctx, ednQuery, "application/edn")
 }
 
 func (s *Storage) QueryRawAsJson(ednQuery []byte) ([]byte, error) {
-	return s.queryRequest(ednQuery, "application/json")
+	return s.queryRequest(context.Background(), ednQuery, "application/json")
+}
+
+// QueryRawAsJsonCtx is like QueryRawAsJson but propagates ctx cancellation
+// and deadlines to the outbound request.
+func (s *Storage) QueryRawAsJsonCtx(ctx context.Context, ednQuery []byte) ([]byte, error) {
+	return s.queryRequest(ctx, ednQuery, "application/json")
 }
 
 func (s *Storage) Query(ednQuery []byte) ([]byte, error) {
-	b, err := s.queryRequest(ednQuery, "application/edn")
-	if err != nil {
-		return nil, err
-	}
+	return s.QueryCtx(context.Background(), ednQuery)
+}
 
-	var p [][]map[edn.Keyword]any
-	if err = edn.Unmarshal(b, &p); err != nil {
+// QueryCtx is like Query but propagates ctx cancellation and deadlines to
+// the outbound request. It is a thin wrapper over QueryStream that
+// materializes every row into the legacy []map[edn.Keyword]any shape.
+func (s *Storage) QueryCtx(ctx context.Context, ednQuery []byte) ([]byte, error) {
+	it, err := s.QueryStream(ctx, ednQuery)
+	if err != nil {
 		return nil, err
 	}
 
 	r := make([]map[edn.Keyword]any, 0)
-	for _, l := range p {
-		r = append(r, l[0])
+	for it.Next() {
+		var row map[edn.Keyword]any
+		if err := it.Scan(&row); err != nil {
+			return nil, err
+		}
+		r = append(r, row)
 	}
-
-	response, err := edn.Marshal(r)
-	if err != nil {
+	if err := it.Err(); err != nil {
 		return nil, err
 	}
 
-	return response, nil
+	return edn.Marshal(r)
 }
 
 func (s *Storage) QueryAsJson(ednQuery []byte) ([]byte, error) {
-	b, err := s.queryRequest(ednQuery, "application/json")
-	if err != nil {
-		return nil, err
-	}
+	return s.QueryAsJsonCtx(context.Background(), ednQuery)
+}
 
-	var p [][]map[string]any
-	if err = json.Unmarshal(b, &p); err != nil {
+// QueryAsJsonCtx is like QueryAsJson but propagates ctx cancellation and
+// deadlines to the outbound request. Like QueryCtx, it is a thin wrapper
+// over QueryStream: it takes each row's first column (the usual shape
+// for a pull query returning one entity per row) and marshals the
+// collected columns as a JSON array.
+func (s *Storage) QueryAsJsonCtx(ctx context.Context, ednQuery []byte) ([]byte, error) {
+	it, err := s.QueryStream(ctx, ednQuery)
+	if err != nil {
 		return nil, err
 	}
 
 	r := make([]map[string]any, 0)
-	for _, l := range p {
-		r = append(r, l[0])
+	for it.Next() {
+		var col map[string]any
+		if err := it.Scan(&col); err != nil {
+			return nil, err
+		}
+		r = append(r, col)
 	}
-
-	response, err := json.Marshal(r)
-	if err != nil {
+	if err := it.Err(); err != nil {
 		return nil, err
 	}
 
-	return response, nil
+	return json.Marshal(r)
 }
 
 // Sync will wait for xtdb to sync all documents
 // if it reaches the timeout, it will return a 5xx error
 func (s *Storage) Sync(timeout time.Duration) error {
-	ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
-	var response []string
+	return s.SyncCtx(context.Background(), timeout)
+}
+
+// SyncCtx is like Sync, but it derives its deadline from ctx as well as
+// timeout, and the retry loop exits as soon as ctx is done instead of
+// spinning until the local timeout fires. This lets callers cancel an
+// in-flight sync (e.g. on graceful shutdown) without leaking the goroutine.
+func (s *Storage) SyncCtx(ctx context.Context, timeout time.Duration) error {
+	ctx, cancelFn := context.WithTimeout(ctx, timeout)
+	defer cancelFn()
+	ctx = withRequestMeta(ctx, requestMeta{op: "sync"})
 	url := fmt.Sprintf("%s/_xtdb/sync?timeout=%v", s.address, timeout.Milliseconds())
+
+	// resultC is only ever written by the goroutine below - once, from
+	// whichever of its two terminal branches (request-build failure or
+	// success) it reaches - so reading it here is race-free, unlike a
+	// bare shared slice written by one goroutine and read by another
+	// with no synchronization. The buffer of 1 means that send can
+	// never block, even if ctx is canceled/times out before it happens.
+	resultC := make(chan error, 1)
 	go func() {
 	exit:
 		for i := 1; ; i++ {
 			select {
 			case <-ctx.Done():
-				response = append(response, "timeout reached")
+				break exit
 			default:
 				log.Debugf("attempt=%v - trying sync to xtdb at %v", i, url)
-				resp, err := http.Get(url)
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 				if err != nil {
-					response = append(response, fmt.Sprintf("attempt=%v, failed sync xtdb, error=%v", i, err))
-					time.Sleep(time.Second * 2)
-					continue
+					resultC <- fmt.Errorf("attempt=%v, failed building sync request, error=%v", i, err)
+					break exit
 				}
-				if resp.StatusCode != 200 {
-					data, _ := io.ReadAll(resp.Body)
-					if resp.Body != nil {
-						_ = resp.Body.Close()
-					}
-					response = append(response, fmt.Sprintf("attempt=%v, failed sync xtdb, status=%v, response=%v",
-						i, resp.StatusCode, string(data)))
+				resp, err := s.do(req)
+				if err != nil {
+					log.Debugf("attempt=%v, failed sync xtdb, error=%v", i, err)
 					time.Sleep(time.Second * 2)
 					continue
 				}
-				response = nil
+				_ = resp.Body.Close()
+				resultC <- nil
 				cancelFn()
 				break exit
 			}
 		}
 	}()
 	<-ctx.Done()
-	if len(response) > 0 {
-		return fmt.Errorf(strings.Join(response, "; "))
+	// resultC is checked only non-blockingly: if it's empty here, ctx
+	// was canceled/timed out before the goroutine reached a terminal
+	// branch, distinguishing that case from the
+	// goroutine's own cancelFn() on success, which always races the
+	// send ahead of the close per Go's channel happens-before rules.
+	select {
+	case err := <-resultC:
+		return err
+	default:
 	}
-	return nil
+	if err := ctx.Err(); err == context.DeadlineExceeded {
+		return fmt.Errorf("timeout reached syncing xtdb")
+	}
+	return fmt.Errorf("sync canceled: %w", ctx.Err())
 }
 
 func EntityToMap(obj any) map[string]any {
@@ -397,10 +506,11 @@ func EntityToMap(obj any) map[string]any {
 	return payload
 }
 
-func (s *Storage) queryRequest(ednQuery []byte, contentType string) ([]byte, error) {
+func (s *Storage) queryRequest(ctx context.Context, ednQuery []byte, contentType string) ([]byte, error) {
 	url := fmt.Sprintf("%s/_xtdb/query", s.address)
 
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(ednQuery))
+	ctx = withRequestMeta(ctx, requestMeta{op: "query"})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(ednQuery))
 	if err != nil {
 		return nil, err
 	}
@@ -408,18 +518,13 @@ func (s *Storage) queryRequest(ednQuery []byte, contentType string) ([]byte, err
 	req.Header.Set("accept", contentType)
 	req.Header.Set("content-type", "application/edn")
 
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return b, nil
+	return ioutil.ReadAll(resp.Body)
 }
 
 func buildPersistPayload(payloads []map[string]any) ([]byte, error) {
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/runopsio/hoop/common/log"
+
+	"olympos.io/encoding/edn"
+)
+
+const (
+	defaultBatcherMaxOps        = 100
+	defaultBatcherMaxBytes      = 1 << 20 // 1MiB
+	defaultBatcherFlushInterval = time.Second
+	defaultBatcherMaxInflight   = 4
+)
+
+type (
+	// BatcherOptions configures a TxBatcher. Zero values fall back to
+	// sane defaults via withDefaults.
+	BatcherOptions struct {
+		// MaxOps caps the number of tx-ops coalesced into a single
+		// submit-tx request before it is flushed.
+		MaxOps int
+		// MaxBytes caps the combined encoded size of the tx-ops
+		// coalesced into a single submit-tx request before it is
+		// flushed; the surrounding {:tx-ops [...]} wrapper is not
+		// counted, and a single op larger than MaxBytes is still
+		// submitted on its own.
+		MaxBytes int
+		// FlushInterval flushes pending ops even when neither MaxOps
+		// nor MaxBytes has been reached yet.
+		FlushInterval time.Duration
+		// MaxInflight caps the number of submit-tx requests in flight
+		// at once. Once reached, flush blocks handing off further
+		// chunks until a slot frees up. Enqueue/EnqueueEvict do not
+		// block meanwhile; ops they add keep accumulating in the queue
+		// until the next flush.
+		MaxInflight int
+	}
+
+	// TxResult is delivered to a batcher caller once the batch
+	// containing its operation has been submitted and (best-effort)
+	// awaited via AwaitTxCtx.
+	TxResult struct {
+		TxID int64
+		Err  error
+	}
+
+	batchOp struct {
+		ednOp  string
+		result chan TxResult
+	}
+
+	// TxBatcher coalesces put/evict transactions queued via Enqueue and
+	// EnqueueEvict into a single submit-tx request, flushing on a size
+	// or time trigger and fanning out the resulting TxID (or error) to
+	// each waiter. Create one with Storage.NewBatcher.
+	TxBatcher struct {
+		storage *Storage
+		opts    BatcherOptions
+
+		mu     sync.Mutex
+		queue  []batchOp
+		bytes  int
+		closed bool
+
+		inflight chan struct{}
+		flushC   chan struct{}
+		closeC   chan struct{}
+		doneC    chan struct{}
+
+		// wg tracks submissions launched by flush that are still in
+		// flight, so Close can wait for the drain to actually finish
+		// instead of just for the flush loop to exit.
+		wg sync.WaitGroup
+
+		// seq generates a distinct Idempotency-Key per flushed batch, so
+		// a transient failure submitting it is retried by WithRetry
+		// instead of failing every op in the batch outright.
+		seq uint64
+	}
+)
+
+// ErrBatcherClosed is returned by Enqueue/EnqueueEvict once Close has
+// been called; the caller must not have relied on that op reaching the
+// server.
+var ErrBatcherClosed = errors.New("storage: batcher is closed")
+
+func (o BatcherOptions) withDefaults() BatcherOptions {
+	if o.MaxOps <= 0 {
+		o.MaxOps = defaultBatcherMaxOps
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = defaultBatcherMaxBytes
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaultBatcherFlushInterval
+	}
+	if o.MaxInflight <= 0 {
+		o.MaxInflight = defaultBatcherMaxInflight
+	}
+	return o
+}
+
+// NewBatcher creates a TxBatcher bound to s and starts its flush loop.
+func (s *Storage) NewBatcher(opts BatcherOptions) *TxBatcher {
+	opts = opts.withDefaults()
+	b := &TxBatcher{
+		storage:  s,
+		opts:     opts,
+		inflight: make(chan struct{}, opts.MaxInflight),
+		flushC:   make(chan struct{}, 1),
+		closeC:   make(chan struct{}),
+		doneC:    make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+// Enqueue queues a put transaction, returning a channel that receives the
+// TxID (or error) once the batch containing it has been submitted.
+func (b *TxBatcher) Enqueue(tx TxEdnStruct) <-chan TxResult {
+	txEdn, err := edn.Marshal(tx)
+	if err != nil {
+		return errResultChan(err)
+	}
+	return b.enqueue(fmt.Sprintf(`[:xtdb.api/put %v]`, string(txEdn)))
+}
+
+// EnqueueEvict queues an evict transaction, returning a channel that
+// receives the TxID (or error) once the batch containing it has been
+// submitted.
+func (b *TxBatcher) EnqueueEvict(xtID string) <-chan TxResult {
+	return b.enqueue(fmt.Sprintf(`[:xtdb.api/evict %q]`, xtID))
+}
+
+func errResultChan(err error) <-chan TxResult {
+	c := make(chan TxResult, 1)
+	c <- TxResult{Err: err}
+	return c
+}
+
+func (b *TxBatcher) enqueue(ednOp string) <-chan TxResult {
+	result := make(chan TxResult, 1)
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		result <- TxResult{Err: ErrBatcherClosed}
+		return result
+	}
+	b.queue = append(b.queue, batchOp{ednOp: ednOp, result: result})
+	b.bytes += len(ednOp)
+	shouldFlush := len(b.queue) >= b.opts.MaxOps || b.bytes >= b.opts.MaxBytes
+	b.mu.Unlock()
+
+	if shouldFlush {
+		select {
+		case b.flushC <- struct{}{}:
+		default:
+		}
+	}
+	return result
+}
+
+func (b *TxBatcher) loop() {
+	defer close(b.doneC)
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.flush()
+		case <-b.flushC:
+			b.flush()
+		case <-b.closeC:
+			b.flush()
+			return
+		}
+	}
+}
+
+// flush drains the pending queue and submits it as one or more chunks,
+// each respecting MaxOps/MaxBytes, blocking for a free inflight slot
+// when MaxInflight submissions are already outstanding. This keeps a
+// backlog that built up past the configured limits (e.g. while the
+// flush loop was blocked on a full inflight channel) from being shipped
+// as a single oversized {:tx-ops [...]} body.
+func (b *TxBatcher) flush() {
+	b.mu.Lock()
+	ops := b.queue
+	b.queue = nil
+	b.bytes = 0
+	b.mu.Unlock()
+
+	for len(ops) > 0 {
+		var chunk []batchOp
+		chunk, ops = splitBatch(ops, b.opts.MaxOps, b.opts.MaxBytes)
+
+		b.inflight <- struct{}{}
+		b.wg.Add(1)
+		go func(chunk []batchOp) {
+			defer b.wg.Done()
+			defer func() { <-b.inflight }()
+			b.submit(chunk)
+		}(chunk)
+	}
+}
+
+// splitBatch takes a prefix of ops whose op count stays within maxOps and
+// whose combined ednOp size stays within maxBytes, returning that prefix
+// and the remaining ops. It always takes at least one op, so a single op
+// larger than maxBytes on its own cannot wedge the batcher.
+func splitBatch(ops []batchOp, maxOps, maxBytes int) (chunk, rest []batchOp) {
+	size := 0
+	n := 0
+	for n < len(ops) && n < maxOps {
+		opSize := len(ops[n].ednOp)
+		if n > 0 && size+opSize > maxBytes {
+			break
+		}
+		size += opSize
+		n++
+	}
+	return ops[:n], ops[n:]
+}
+
+// nextIdempotencyKey returns a key unique to this batcher and this
+// flushed batch, suitable for an Idempotency-Key header.
+func (b *TxBatcher) nextIdempotencyKey() string {
+	n := atomic.AddUint64(&b.seq, 1)
+	return fmt.Sprintf("batcher-%p-%d", b, n)
+}
+
+func (b *TxBatcher) submit(ops []batchOp) {
+	trxVector := make([]string, 0, len(ops))
+	for _, op := range ops {
+		trxVector = append(trxVector, op.ednOp)
+	}
+	txOpsEdn := fmt.Sprintf(`{:tx-ops [%v]}`, strings.Join(trxVector, ""))
+
+	// Each flushed batch gets its own Idempotency-Key so a transient
+	// failure submitting it is eligible for retry under WithRetry
+	// instead of failing every op in the batch outright; the batcher
+	// itself owns the key since ops coalesced from distinct
+	// Enqueue/EnqueueEvict callers share a single submit-tx request.
+	ctx := WithIdempotencyKey(context.Background(), b.nextIdempotencyKey())
+	txResponse, err := b.storage.submitTxEdnCtx(ctx, txOpsEdn, len(ops))
+	if err != nil {
+		for _, op := range ops {
+			op.result <- TxResult{Err: err}
+		}
+		return
+	}
+
+	// make a best-effort to wait the batch's transaction to sync
+	if txResponse.TxID > 0 {
+		if err := b.storage.AwaitTxCtx(context.Background(), txResponse.TxID); err != nil {
+			log.Warnf(err.Error())
+		}
+	}
+	for _, op := range ops {
+		op.result <- TxResult{TxID: txResponse.TxID}
+	}
+}
+
+// Close stops accepting new flushes, submits any remaining queued
+// operations, and waits for every submission launched by flush to
+// actually complete (not merely be launched) or ctx to be done,
+// whichever happens first.
+func (b *TxBatcher) Close(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.closeC)
+	select {
+	case <-b.doneC:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
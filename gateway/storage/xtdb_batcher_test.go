@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestTxBatcherCloseWaitsForInflightSubmit covers the bug fixed in Close:
+// it must wait for a submission that's already been handed off to a
+// goroutine to actually finish, not just for the flush loop to exit.
+func TestTxBatcherCloseWaitsForInflightSubmit(t *testing.T) {
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_xtdb/submit-tx", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("content-type", "application/edn")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{:xtdb.api/tx-id 1}`))
+	})
+	mux.HandleFunc("/_xtdb/await-tx", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	s := New()
+	s.SetURL(ts.URL)
+
+	b := s.NewBatcher(BatcherOptions{MaxOps: 1, FlushInterval: time.Hour})
+	resultC := b.EnqueueEvict("entity-a")
+
+	// give the flush loop a moment to pick the op up and call submit,
+	// which blocks in the handler above until release is closed.
+	time.Sleep(50 * time.Millisecond)
+
+	closeDone := make(chan error, 1)
+	go func() { closeDone <- b.Close(context.Background()) }()
+
+	select {
+	case <-closeDone:
+		t.Fatal("Close returned before the in-flight submission finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case err := <-closeDone:
+		if err != nil {
+			t.Fatalf("Close returned an error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return after the submission finished")
+	}
+
+	select {
+	case res := <-resultC:
+		if res.Err != nil {
+			t.Fatalf("unexpected result error: %v", res.Err)
+		}
+	default:
+		t.Fatal("result channel never received a value")
+	}
+}
+
+// TestTxBatcherEnqueueAfterClose covers the bug fixed in enqueue: an op
+// queued after Close has returned must not be silently dropped - it
+// should get an immediate error instead of a result channel that never
+// receives a value.
+func TestTxBatcherEnqueueAfterClose(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/edn")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{:xtdb.api/tx-id 1}`))
+	}))
+	defer ts.Close()
+
+	s := New()
+	s.SetURL(ts.URL)
+
+	b := s.NewBatcher(BatcherOptions{})
+	if err := b.Close(context.Background()); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+
+	resultC := b.EnqueueEvict("entity-a")
+	select {
+	case res := <-resultC:
+		if !errors.Is(res.Err, ErrBatcherClosed) {
+			t.Fatalf("expected ErrBatcherClosed, got %v", res.Err)
+		}
+	default:
+		t.Fatal("expected Enqueue after Close to deliver a result immediately")
+	}
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"olympos.io/encoding/edn"
+)
+
+// StorageError is returned whenever an xtdb request completes with a
+// non-2xx status code, instead of the ad hoc fmt.Errorf/errors.New
+// strings this package used to return. Callers can switch on StatusCode
+// or XTDBErrorClass directly, or use the Is* helpers below.
+type StorageError struct {
+	StatusCode int
+	// XTDBErrorClass and XTDBMessage are parsed, best-effort, from the
+	// response body's :xtdb.error/class and :xtdb.error/message keys.
+	// Both are empty when the body carries neither (e.g. a plain-text
+	// proxy error).
+	XTDBErrorClass string
+	XTDBMessage    string
+	// TxID is set when the error is known to be associated with a
+	// specific transaction, e.g. a failed AwaitTxCtx.
+	TxID int64
+	Body []byte
+}
+
+func (e *StorageError) Error() string {
+	var txSuffix string
+	if e.TxID > 0 {
+		txSuffix = fmt.Sprintf(", tx-id=%v", e.TxID)
+	}
+	if e.XTDBErrorClass != "" {
+		return fmt.Sprintf("xtdb request failed, status=%v, class=%v, message=%v%v",
+			e.StatusCode, e.XTDBErrorClass, e.XTDBMessage, txSuffix)
+	}
+	return fmt.Sprintf("xtdb request failed, status=%v, body=%v%v", e.StatusCode, string(e.Body), txSuffix)
+}
+
+// xtdbErrorBody mirrors the shape xtdb uses for its error responses,
+// e.g. {:xtdb.error/class :xtdb.api/illegal-argument, :xtdb.error/message "..."}.
+type xtdbErrorBody struct {
+	Class   string `edn:"xtdb.error/class" json:"xtdb.error/class"`
+	Message string `edn:"xtdb.error/message" json:"xtdb.error/message"`
+}
+
+// newStorageError builds a StorageError out of a non-2xx response,
+// best-effort parsing the xtdb error body out of resp's content-type.
+func newStorageError(resp *http.Response, body []byte) *StorageError {
+	storageErr := &StorageError{StatusCode: resp.StatusCode, Body: body}
+	var xtdbErr xtdbErrorBody
+	if strings.Contains(resp.Header.Get("content-type"), "json") {
+		_ = json.Unmarshal(body, &xtdbErr)
+	} else {
+		_ = edn.Unmarshal(body, &xtdbErr)
+	}
+	storageErr.XTDBErrorClass = xtdbErr.Class
+	storageErr.XTDBMessage = xtdbErr.Message
+	return storageErr
+}
+
+// withTxID annotates err with txID when it is a *StorageError, returning
+// err unchanged otherwise.
+func withTxID(err error, txID int64) error {
+	var storageErr *StorageError
+	if errors.As(err, &storageErr) {
+		storageErr.TxID = txID
+	}
+	return err
+}
+
+// IsNotFound reports whether err is a StorageError for a 404 response,
+// e.g. from GetEntityCtx/GetEntityHistoryCtx.
+func IsNotFound(err error) bool {
+	var storageErr *StorageError
+	return errors.As(err, &storageErr) && storageErr.StatusCode == http.StatusNotFound
+}
+
+// IsTxAborted reports whether err is a StorageError describing a
+// transaction that xtdb rejected or aborted (e.g. a 409 conflict, or a
+// :xtdb.api/tx-event-error class).
+func IsTxAborted(err error) bool {
+	var storageErr *StorageError
+	if !errors.As(err, &storageErr) {
+		return false
+	}
+	return storageErr.StatusCode == http.StatusConflict ||
+		strings.Contains(storageErr.XTDBErrorClass, "tx-event")
+}
+
+// IsNodeUnavailable reports whether err is a StorageError for a 503
+// response, typically emitted while an xtdb node is rebalancing or not
+// yet caught up.
+func IsNodeUnavailable(err error) bool {
+	var storageErr *StorageError
+	return errors.As(err, &storageErr) && storageErr.StatusCode == http.StatusServiceUnavailable
+}
+
+// do executes req, applying retry/backoff and circuit breaking when
+// WithRetry has been configured, and classifies the response. A 2xx
+// status is returned as-is, with the body left open for the caller to
+// read and close. Any other status drains the body into a *StorageError
+// and closes it, so callers never have to duplicate status-code switches
+// or leak resp.Body on the error path.
+func (s *Storage) do(req *http.Request) (*http.Response, error) {
+	if s.breaker != nil && !s.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := s.dispatch(req)
+	if s.breaker != nil && !errors.Is(err, ErrCircuitOpen) {
+		if err != nil {
+			s.breaker.recordFailure()
+		} else {
+			s.breaker.recordSuccess()
+		}
+	}
+	return resp, err
+}
+
+// dispatch issues req once, or with retries when WithRetry is configured
+// and req is idempotent; see isIdempotent.
+func (s *Storage) dispatch(req *http.Request) (*http.Response, error) {
+	if s.retryPolicy == nil || !isIdempotent(req) {
+		return s.doOnce(req)
+	}
+	return s.doWithRetry(req)
+}
+
+// doOnce issues req exactly once, recording its latency/status as a
+// metric and as attributes on a span, both keyed off the operation in
+// req's context (see requestMeta).
+func (s *Storage) doOnce(req *http.Request) (*http.Response, error) {
+	meta := requestMetaFromContext(req.Context())
+	req, finishSpan := s.traceRequest(req)
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	dur := time.Since(start)
+
+	if err != nil {
+		finishSpan(0, err)
+		s.recordRequest(meta.op, 0, dur, 0)
+		return nil, err
+	}
+	if resp == nil {
+		err := fmt.Errorf("http response is empty")
+		finishSpan(0, err)
+		s.recordRequest(meta.op, 0, dur, 0)
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		finishSpan(resp.StatusCode, nil)
+		s.recordRequest(meta.op, resp.StatusCode, dur, resp.ContentLength)
+		return resp, nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	storageErr := newStorageError(resp, body)
+	finishSpan(resp.StatusCode, storageErr)
+	s.recordRequest(meta.op, resp.StatusCode, dur, int64(len(body)))
+	return nil, storageErr
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/runopsio/hoop/gateway/storage"
+
+// Options configures the observability New() does not set up:
+// Prometheus metrics, and the OpenTelemetry tracer provider used for
+// per-request spans and the http.Client transport. With the zero value,
+// NewWithOptions differs from New() only in wrapping the transport with
+// otelhttp on otel.GetTracerProvider().
+type Options struct {
+	// Registerer, when set, receives the request count, latency,
+	// response size, and retry count collectors. Nil disables metrics.
+	Registerer prometheus.Registerer
+	// TracerProvider, when set, is used to open a span per outbound
+	// request and to instrument the underlying http.Client transport.
+	// Nil falls back to otel.GetTracerProvider().
+	TracerProvider trace.TracerProvider
+}
+
+// NewWithOptions is like New but wires up the collectors and tracer
+// described by opts. Every request issued through do then records, per
+// operation (submit-tx, evict-tx, query, entity, entity-history,
+// await-tx, sync): request count, latency, response size, HTTP status
+// code, and retry count, and opens a span carrying xtdb.tx_id,
+// xtdb.op_count, and xtdb.endpoint attributes.
+func NewWithOptions(opts Options) *Storage {
+	s := New()
+	if opts.Registerer != nil {
+		s.metrics = newMetrics(opts.Registerer)
+	}
+	s.tracerProvider = opts.TracerProvider
+	s.client.Transport = otelhttp.NewTransport(s.client.Transport,
+		otelhttp.WithTracerProvider(s.tracerProviderOrDefault()))
+	return s
+}
+
+func (s *Storage) tracerProviderOrDefault() trace.TracerProvider {
+	if s.tracerProvider != nil {
+		return s.tracerProvider
+	}
+	return otel.GetTracerProvider()
+}
+
+func (s *Storage) tracer() trace.Tracer {
+	return s.tracerProviderOrDefault().Tracer(tracerName)
+}
+
+// requestMeta carries the domain attributes attached to a request's span
+// and metric labels: which operation it is, and (when known up front)
+// how many tx-ops it carries or which tx-id it concerns.
+type requestMeta struct {
+	op      string
+	opCount int
+	txID    int64
+}
+
+type requestMetaCtxKey struct{}
+
+func withRequestMeta(ctx context.Context, m requestMeta) context.Context {
+	return context.WithValue(ctx, requestMetaCtxKey{}, m)
+}
+
+func requestMetaFromContext(ctx context.Context) requestMeta {
+	if m, ok := ctx.Value(requestMetaCtxKey{}).(requestMeta); ok {
+		return m
+	}
+	return requestMeta{op: "unknown"}
+}
+
+// metrics holds the Prometheus collectors shared by every Storage
+// operation issued through do.
+type metrics struct {
+	requestsTotal  *prometheus.CounterVec
+	latencySeconds *prometheus.HistogramVec
+	responseBytes  *prometheus.HistogramVec
+	retriesTotal   *prometheus.CounterVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "hoop",
+			Subsystem: "xtdb",
+			Name:      "requests_total",
+			Help:      "Total xtdb requests issued by Storage, by operation and status code.",
+		}, []string{"op", "status"}),
+		latencySeconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "hoop",
+			Subsystem: "xtdb",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of xtdb requests issued by Storage, by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"op"}),
+		responseBytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "hoop",
+			Subsystem: "xtdb",
+			Name:      "response_size_bytes",
+			Help:      "Size of xtdb responses read by Storage, by operation. Approximated from Content-Length when the body is streamed rather than buffered.",
+			Buckets:   prometheus.ExponentialBuckets(128, 4, 8),
+		}, []string{"op"}),
+		retriesTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "hoop",
+			Subsystem: "xtdb",
+			Name:      "retries_total",
+			Help:      "Retries performed under Storage.WithRetry, by operation.",
+		}, []string{"op"}),
+	}
+	reg.MustRegister(m.requestsTotal, m.latencySeconds, m.responseBytes, m.retriesTotal)
+	return m
+}
+
+func (s *Storage) recordRequest(op string, status int, dur time.Duration, responseSize int64) {
+	if s.metrics == nil {
+		return
+	}
+	s.metrics.requestsTotal.WithLabelValues(op, strconv.Itoa(status)).Inc()
+	s.metrics.latencySeconds.WithLabelValues(op).Observe(dur.Seconds())
+	if responseSize > 0 {
+		s.metrics.responseBytes.WithLabelValues(op).Observe(float64(responseSize))
+	}
+}
+
+func (s *Storage) recordRetries(op string, retries int) {
+	if s.metrics == nil || retries <= 0 {
+		return
+	}
+	s.metrics.retriesTotal.WithLabelValues(op).Add(float64(retries))
+}
+
+// traceRequest opens a span for req named after its operation, with the
+// domain attributes requestMeta carries, and returns req bound to the
+// span's context along with a finish func the caller must invoke with
+// the outcome (status is 0 on transport failure).
+func (s *Storage) traceRequest(req *http.Request) (*http.Request, func(status int, err error)) {
+	meta := requestMetaFromContext(req.Context())
+	ctx, span := s.tracer().Start(req.Context(), "xtdb."+meta.op, trace.WithAttributes(
+		attribute.String("xtdb.endpoint", req.URL.Path),
+		attribute.Int("xtdb.op_count", meta.opCount),
+		attribute.Int64("xtdb.tx_id", meta.txID),
+	))
+	finish := func(status int, err error) {
+		defer span.End()
+		if status > 0 {
+			span.SetAttributes(attribute.Int("http.status_code", status))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	return req.WithContext(ctx), finish
+}
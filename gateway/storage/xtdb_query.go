@@ -0,0 +1,326 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"olympos.io/encoding/edn"
+)
+
+// Decoder converts a raw EDN value decoded off a query row column into a
+// Go value of the caller's choosing. Register one with
+// QueryIterator.RegisterDecoder to teach Scan how to turn EDN types
+// (edn.Keyword, #inst, #uuid, ...) into application types without the
+// caller having to re-parse the row.
+type Decoder interface {
+	// Decode converts v, as produced by decoding a row column into
+	// `any`, into dest, which is always a non-nil pointer.
+	Decode(v any, dest any) error
+}
+
+// DecoderFunc adapts a plain function to the Decoder interface.
+type DecoderFunc func(v any, dest any) error
+
+func (f DecoderFunc) Decode(v any, dest any) error { return f(v, dest) }
+
+// QueryIterator iterates the rows of a query result one at a time via
+// Next/Scan, instead of the caller having to unmarshal the whole
+// response up front. Obtain one with Storage.QueryStream.
+type QueryIterator struct {
+	closer io.Closer
+	br     *bufio.Reader
+
+	started  bool
+	finished bool
+	row      []any
+	err      error
+	decoders map[reflect.Type]Decoder
+}
+
+// QueryStream issues ednQuery against the xtdb query endpoint with a
+// chunked transfer encoding and returns an iterator over its rows. xtdb
+// encodes the whole result set as a single top-level EDN vector of row
+// vectors, so the iterator reads the response body incrementally off the
+// wire with a small bracket-depth scanner, decoding and handing back one
+// row at a time instead of buffering the full result set into memory.
+func (s *Storage) QueryStream(ctx context.Context, ednQuery []byte) (*QueryIterator, error) {
+	url := fmt.Sprintf("%s/_xtdb/query", s.address)
+	ctx = withRequestMeta(ctx, requestMeta{op: "query"})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(ednQuery))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("accept", "application/edn")
+	req.Header.Set("content-type", "application/edn")
+	req.TransferEncoding = []string{"chunked"}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryIterator{
+		closer:   resp.Body,
+		br:       bufio.NewReader(resp.Body),
+		decoders: map[reflect.Type]Decoder{},
+	}, nil
+}
+
+// RegisterDecoder teaches the iterator how to populate dest's type when
+// Scan is called against it. Call it before the first Next/Scan.
+func (it *QueryIterator) RegisterDecoder(dest any, d Decoder) {
+	it.decoders[reflect.TypeOf(dest)] = d
+}
+
+// Next reads and decodes the next row off the wire, returning false once
+// rows are exhausted or a read/decode error occurs - check Err to tell
+// the two apart. The underlying response body is closed automatically
+// once Next returns false; callers that stop iterating early should call
+// Close to avoid leaking the connection.
+func (it *QueryIterator) Next() bool {
+	if it.err != nil || it.finished {
+		return false
+	}
+	if !it.started {
+		if err := it.openVector(); err != nil {
+			it.fail(err)
+			return false
+		}
+		it.started = true
+	}
+
+	raw, ok, err := it.readNextRow()
+	if err != nil {
+		it.fail(err)
+		return false
+	}
+	if !ok {
+		it.finished = true
+		_ = it.Close()
+		return false
+	}
+
+	var row []any
+	if err := edn.Unmarshal(raw, &row); err != nil {
+		it.fail(fmt.Errorf("decode row: %w", err))
+		return false
+	}
+	it.row = row
+	return true
+}
+
+func (it *QueryIterator) fail(err error) {
+	it.err = err
+	it.finished = true
+	_ = it.Close()
+}
+
+// Close releases the underlying HTTP response body. It is safe to call
+// multiple times, including after Next has already closed it.
+func (it *QueryIterator) Close() error {
+	if it.closer == nil {
+		return nil
+	}
+	err := it.closer.Close()
+	it.closer = nil
+	return err
+}
+
+// Err returns the first error encountered while reading or scanning
+// rows, if any.
+func (it *QueryIterator) Err() error { return it.err }
+
+// Scan decodes the current row's columns into dest, in find-clause order.
+// Each dest must be a non-nil pointer. A Decoder registered for dest's
+// type via RegisterDecoder is consulted first; otherwise the column value
+// is round-tripped through edn.Marshal/Unmarshal into dest.
+func (it *QueryIterator) Scan(dest ...any) error {
+	if it.row == nil {
+		return fmt.Errorf("scan called without a successful call to Next")
+	}
+	if len(dest) > len(it.row) {
+		return fmt.Errorf("scan requested %v columns, row has %v", len(dest), len(it.row))
+	}
+	for i, d := range dest {
+		if err := it.decodeInto(it.row[i], d); err != nil {
+			it.err = fmt.Errorf("column %v: %w", i, err)
+			return it.err
+		}
+	}
+	return nil
+}
+
+func (it *QueryIterator) decodeInto(v, dest any) error {
+	if dec, ok := it.decoders[reflect.TypeOf(dest)]; ok {
+		return dec.Decode(v, dest)
+	}
+	b, err := edn.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return edn.Unmarshal(b, dest)
+}
+
+// openVector consumes leading whitespace and the opening '[' of the
+// response's top-level row vector.
+func (it *QueryIterator) openVector() error {
+	for {
+		b, err := it.br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if isEDNSpace(b) {
+			continue
+		}
+		if b == '[' {
+			return nil
+		}
+		return fmt.Errorf("unexpected leading byte %q in query response", b)
+	}
+}
+
+// readNextRow skips whitespace/comments between rows and, if the closing
+// ']' of the outer vector hasn't been reached yet, reads one complete row
+// (an EDN vector) off the wire. ok is false once the outer vector closes.
+func (it *QueryIterator) readNextRow() (raw []byte, ok bool, err error) {
+	for {
+		b, err := it.br.Peek(1)
+		if err != nil {
+			return nil, false, err
+		}
+		switch {
+		case isEDNSpace(b[0]):
+			_, _ = it.br.ReadByte()
+			continue
+		case b[0] == ';':
+			_, _ = it.br.ReadByte()
+			if err := skipLineComment(it.br); err != nil {
+				return nil, false, err
+			}
+			continue
+		case b[0] == ']':
+			_, _ = it.br.ReadByte()
+			return nil, false, nil
+		}
+		raw, err = readEDNValue(it.br)
+		return raw, true, err
+	}
+}
+
+// readEDNValue reads one complete top-level EDN form off br, returning
+// its raw bytes. It tracks bracket/brace/paren depth to find the form's
+// end, skipping over string and character-literal contents so brackets
+// inside them don't confuse the depth count. Only called with the reader
+// positioned at the start of a vector (a query result row), so depth
+// always starts and ends at zero around a single balanced `[...]`.
+func readEDNValue(br *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	depth := 0
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(b)
+		switch b {
+		case '"':
+			if err := skipString(br, &buf); err != nil {
+				return nil, err
+			}
+		case '\\':
+			if err := skipCharLiteral(br, &buf); err != nil {
+				return nil, err
+			}
+		case '[', '{', '(':
+			depth++
+		case ']', '}', ')':
+			depth--
+		}
+		if depth == 0 {
+			return buf.Bytes(), nil
+		}
+	}
+}
+
+// skipString consumes the remainder of a string literal (the opening
+// quote has already been written to buf), copying every byte - including
+// backslash escapes - into buf so the caller can still decode it.
+func skipString(br *bufio.Reader, buf *bytes.Buffer) error {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(b)
+		if b == '\\' {
+			eb, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			buf.WriteByte(eb)
+			continue
+		}
+		if b == '"' {
+			return nil
+		}
+	}
+}
+
+// skipCharLiteral consumes an EDN character literal such as \a or the
+// named forms \newline/\space/\uXXXX (the leading backslash has already
+// been written to buf).
+func skipCharLiteral(br *bufio.Reader, buf *bytes.Buffer) error {
+	b, err := br.ReadByte()
+	if err != nil {
+		return err
+	}
+	buf.WriteByte(b)
+	if !isEDNSymbolChar(b) {
+		return nil
+	}
+	for {
+		pb, err := br.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if !isEDNSymbolChar(pb[0]) {
+			return nil
+		}
+		b, _ := br.ReadByte()
+		buf.WriteByte(b)
+	}
+}
+
+// skipLineComment consumes up to and including the next newline (the
+// leading ';' has already been consumed by the caller).
+func skipLineComment(br *bufio.Reader) error {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == '\n' {
+			return nil
+		}
+	}
+}
+
+func isEDNSpace(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\r', ',':
+		return true
+	}
+	return false
+}
+
+func isEDNSymbolChar(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestQueryStreamMultiRow covers the row-by-row incremental decode added
+// to QueryStream: multiple rows, an escaped string, a set, and a tagged
+// #inst literal, all in the same response.
+func TestQueryStreamMultiRow(t *testing.T) {
+	body := `[[1 "hello \"world\"" :my/keyword #{1 2 3} #inst "2020-01-01T00:00:00.000-00:00"]
+ [2 "second row" :other/kw #{4} #inst "2021-01-01T00:00:00.000-00:00"]]`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/edn")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	s := New()
+	s.SetURL(ts.URL)
+
+	it, err := s.QueryStream(context.Background(), []byte(`{:query {}}`))
+	if err != nil {
+		t.Fatalf("QueryStream: %v", err)
+	}
+
+	var gotRows int
+	var secondRowString string
+	for it.Next() {
+		var c0, c1, c2, c3, c4 any
+		if err := it.Scan(&c0, &c1, &c2, &c3, &c4); err != nil {
+			t.Fatalf("Scan row %v: %v", gotRows, err)
+		}
+		if gotRows == 0 {
+			if s, ok := c1.(string); !ok || s != `hello "world"` {
+				t.Fatalf("expected escaped string to round-trip, got %#v", c1)
+			}
+		} else {
+			secondRowString, _ = c1.(string)
+		}
+		gotRows++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if gotRows != 2 {
+		t.Fatalf("expected 2 rows, got %v", gotRows)
+	}
+	if secondRowString != "second row" {
+		t.Fatalf("expected second row's string column, got %q", secondRowString)
+	}
+}
+
+// TestQueryStreamBracketsInString covers a row containing bracket
+// characters inside a string literal, making sure the depth-tracking row
+// scanner doesn't mistake them for vector boundaries.
+func TestQueryStreamBracketsInString(t *testing.T) {
+	body := `[[1 "[not { a ( bracket"]]`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/edn")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	s := New()
+	s.SetURL(ts.URL)
+
+	it, err := s.QueryStream(context.Background(), []byte(`{:query {}}`))
+	if err != nil {
+		t.Fatalf("QueryStream: %v", err)
+	}
+
+	if !it.Next() {
+		t.Fatalf("expected one row, got none (err=%v)", it.Err())
+	}
+	var c0, c1 any
+	if err := it.Scan(&c0, &c1); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if s, ok := c1.(string); !ok || s != "[not { a ( bracket" {
+		t.Fatalf("expected the bracket characters to survive as plain string content, got %#v", c1)
+	}
+	if it.Next() {
+		t.Fatal("expected exactly one row")
+	}
+}
+
+// TestQueryAsJsonCtxEmptyRow covers the fix for the index-out-of-range
+// panic QueryAsJsonCtx used to hit when a query row had no columns.
+func TestQueryAsJsonCtxEmptyRow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/edn")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[[]]`))
+	}))
+	defer ts.Close()
+
+	s := New()
+	s.SetURL(ts.URL)
+
+	if _, err := s.QueryAsJsonCtx(context.Background(), []byte(`{:query {}}`)); err == nil {
+		t.Fatal("expected an error for an empty-row result, not a panic")
+	}
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by do when the circuit breaker installed by
+// WithRetry is open, short-circuiting the request instead of letting it
+// reach a node that recent consecutive failures say is unavailable.
+var ErrCircuitOpen = errors.New("storage: circuit breaker is open")
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseDelay   = 100 * time.Millisecond
+	defaultRetryMaxDelay    = 5 * time.Second
+
+	breakerMaxFailures   = 5
+	breakerFailureWindow = 30 * time.Second
+	breakerResetTimeout  = 10 * time.Second
+)
+
+// RetryPolicy configures the retry/backoff behavior WithRetry applies to
+// idempotent requests: GET entity/entity-history, await-tx, sync, and
+// put/evict transactions carrying a client-supplied idempotency key (see
+// WithIdempotencyKey). Backoff is exponential, capped at MaxDelay, with
+// full jitter applied when Jitter is set.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      bool
+	// RetryOn overrides the default classifier, which retries transport
+	// errors and StorageErrors with status 429, 503, or >= 500. Return
+	// true to retry the given (resp, err) pair; resp is always nil here
+	// since a successful response is never retried.
+	RetryOn func(resp *http.Response, err error) bool
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultRetryBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultRetryMaxDelay
+	}
+	if p.RetryOn == nil {
+		p.RetryOn = defaultRetryOn
+	}
+	return p
+}
+
+func defaultRetryOn(_ *http.Response, err error) bool {
+	if err == nil {
+		return false
+	}
+	var storageErr *StorageError
+	if errors.As(err, &storageErr) {
+		return storageErr.StatusCode == http.StatusTooManyRequests ||
+			storageErr.StatusCode >= http.StatusInternalServerError
+	}
+	// transport-level failures (connection reset, timeout, ...) are retryable
+	return true
+}
+
+// WithRetry enables retry/backoff and circuit breaking for requests
+// issued through do, and returns s for chaining. It mutates s in place,
+// mirroring SetURL.
+func (s *Storage) WithRetry(policy RetryPolicy) *Storage {
+	policy = policy.withDefaults()
+	s.retryPolicy = &policy
+	s.breaker = newCircuitBreaker(breakerMaxFailures, breakerFailureWindow, breakerResetTimeout)
+	return s
+}
+
+// isIdempotent reports whether req is safe to retry: all GETs (entity,
+// entity-history, await-tx, sync) are, and a PUT/evict submit-tx is only
+// once it carries an Idempotency-Key header (see WithIdempotencyKey).
+func isIdempotent(req *http.Request) bool {
+	if req.Method == http.MethodGet {
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+type idempotencyKeyCtxKey struct{}
+
+// WithIdempotencyKey attaches a client-supplied idempotency key to ctx.
+// SubmitPutTxCtx and SubmitEvictTxCtx forward it as an Idempotency-Key
+// header, which makes the submit-tx request eligible for retry under
+// WithRetry: a node seeing the same key twice is expected to dedupe
+// rather than double-apply the transaction. TxBatcher generates its own
+// key per flushed batch instead, since Enqueue/EnqueueEvict take no ctx
+// and several callers' ops can share one submit-tx request.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtxKey{}, key)
+}
+
+func idempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtxKey{}).(string)
+	return key
+}
+
+// doWithRetry retries req, cloning it (and its body, via GetBody) for
+// each attempt after the first, until policy.MaxAttempts is reached or
+// policy.RetryOn declines to retry the latest error.
+func (s *Storage) doWithRetry(req *http.Request) (*http.Response, error) {
+	policy := *s.retryPolicy
+	meta := requestMetaFromContext(req.Context())
+	var lastErr error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-req.Context().Done():
+				s.recordRetries(meta.op, attempt-1)
+				return nil, req.Context().Err()
+			case <-time.After(backoffDelay(policy, attempt-1)):
+			}
+		}
+
+		attemptReq := req
+		if attempt > 1 {
+			attemptReq = cloneRequest(req)
+		}
+
+		resp, err := s.doOnce(attemptReq)
+		if err == nil {
+			s.recordRetries(meta.op, attempt-1)
+			return resp, nil
+		}
+		lastErr = err
+		if attempt == policy.MaxAttempts || !policy.RetryOn(nil, err) {
+			s.recordRetries(meta.op, attempt-1)
+			return nil, err
+		}
+	}
+	s.recordRetries(meta.op, policy.MaxAttempts-1)
+	return nil, lastErr
+}
+
+func cloneRequest(req *http.Request) *http.Request {
+	clone := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			clone.Body = body
+		}
+	}
+	return clone
+}
+
+// backoffDelay computes the delay before the given retry attempt
+// (1-indexed) using exponential backoff with full jitter, capped at
+// policy.MaxDelay.
+func backoffDelay(policy RetryPolicy, attempt int) time.Duration {
+	d := float64(policy.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if max := float64(policy.MaxDelay); d > max {
+		d = max
+	}
+	if !policy.Jitter {
+		return time.Duration(d)
+	}
+	return time.Duration(rand.Float64() * d)
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker opens after maxFailures consecutive failures within
+// window, then allows a single half-open probe once resetTimeout has
+// elapsed to test whether the node has recovered.
+type circuitBreaker struct {
+	maxFailures  int
+	window       time.Duration
+	resetTimeout time.Duration
+
+	mu           sync.Mutex
+	state        circuitState
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	probing      bool
+}
+
+func newCircuitBreaker(maxFailures int, window, resetTimeout time.Duration) *circuitBreaker {
+	return &circuitBreaker{maxFailures: maxFailures, window: window, resetTimeout: resetTimeout}
+}
+
+// allow reports whether a request may proceed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.resetTimeout {
+			return false
+		}
+		if b.probing {
+			return false
+		}
+		b.state = circuitHalfOpen
+		b.probing = true
+		return true
+	case circuitHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = circuitClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+		b.openedAt = now
+		b.probing = false
+		return
+	}
+	if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+		b.firstFailure = now
+		b.failures = 0
+	}
+	b.failures++
+	if b.failures >= b.maxFailures {
+		b.state = circuitOpen
+		b.openedAt = now
+	}
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSyncCtxSuccess(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	s := New()
+	s.SetURL(ts.URL)
+
+	if err := s.SyncCtx(context.Background(), time.Second); err != nil {
+		t.Fatalf("expected sync to succeed, got %v", err)
+	}
+}
+
+// TestSyncCtxParentCancellation covers the bug fixed in SyncCtx: canceling
+// the parent context mid-sync must surface as an error, not be mistaken
+// for the goroutine's own success-path cancelFn() call.
+func TestSyncCtxParentCancellation(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	s := New()
+	s.SetURL(ts.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	err := s.SyncCtx(ctx, time.Minute)
+	if err == nil {
+		t.Fatal("expected an error when the parent context is canceled mid-sync")
+	}
+}
+
+func TestSyncCtxTimeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	s := New()
+	s.SetURL(ts.URL)
+
+	err := s.SyncCtx(context.Background(), 20*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+}